@@ -0,0 +1,68 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cockroachdb/cockroach/server/status"
+)
+
+// AdminServer serves a node's administrative and status HTTP endpoints on
+// a shared mux, and starts the node's push-based status subsystems (such
+// as the StatsD sink) alongside them.
+type AdminServer struct {
+	mux      *http.ServeMux
+	recorder *status.NodeStatusRecorder
+	statsD   *status.StatsDSink
+}
+
+// NewAdminServer creates an AdminServer which serves recorder's metrics,
+// among the node's other "/_status/" endpoints, on mux, and starts a
+// StatsDSink subscribed to monitor if ctx configures a [status.statsd]
+// collector.
+func NewAdminServer(
+	ctx *Context, mux *http.ServeMux, recorder *status.NodeStatusRecorder, monitor *status.NodeStatusMonitor,
+) (*AdminServer, error) {
+	s := &AdminServer{
+		mux:      mux,
+		recorder: recorder,
+	}
+	s.registerStatusHandlers()
+
+	sink, err := maybeStartStatsDSink(ctx, monitor)
+	if err != nil {
+		return nil, err
+	}
+	s.statsD = sink
+	return s, nil
+}
+
+// registerStatusHandlers mounts the admin server's "/_status/" handlers
+// on its mux.
+func (s *AdminServer) registerStatusHandlers() {
+	registerPrometheusExporter(s.mux, s.recorder)
+}
+
+// Close stops any push-based status subsystems started by the admin
+// server.
+func (s *AdminServer) Close() {
+	if s.statsD != nil {
+		s.statsD.Stop()
+	}
+}
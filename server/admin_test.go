@@ -0,0 +1,80 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/server/status"
+	"github.com/cockroachdb/cockroach/util/hlc"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestRegisterPrometheusExporter verifies that NewAdminServer mounts the
+// PrometheusExporter on its mux at status.StatusVarsPath, by scraping it
+// through a real HTTP server rather than calling the handler directly.
+func TestRegisterPrometheusExporter(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	monitor := status.NewNodeStatusMonitor()
+	recorder := status.NewNodeStatusRecorder(monitor, hlc.NewClock(hlc.UnixNano))
+	monitor.OnCallSuccess(&status.CallSuccessEvent{
+		NodeID: proto.NodeID(1),
+		Method: proto.Get,
+	})
+
+	ctx, err := NewContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	if _, err := NewAdminServer(ctx, mux, recorder, monitor); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + status.StatusVarsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	found := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), `cockroach_calls_success{node="1"} 1`) {
+			found = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("expected scraped response to contain the calls.success sample, but it did not")
+	}
+}
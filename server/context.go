@@ -0,0 +1,137 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Context holds a node's configuration, populated from its config file and
+// command-line flags.
+type Context struct {
+	// StatsDHost is the hostname of a statsd/dogstatsd collector that node
+	// status metrics should be pushed to. An empty value (the default)
+	// disables the StatsDSink.
+	StatsDHost string
+	// StatsDPort is the port of the configured StatsD collector.
+	StatsDPort string
+	// StatsDPrefix is prepended to every metric name pushed to StatsD.
+	StatsDPrefix string
+	// StatsDFlushInterval is how often buffered StatsD metrics are
+	// flushed to the collector; status.NewStatsDSink substitutes its
+	// default flush interval when this is zero.
+	StatsDFlushInterval time.Duration
+	// StatsDTags is a static set of tags (e.g. cluster, region) appended
+	// to every metric pushed to StatsD, in addition to the per-event
+	// node/store tag.
+	StatsDTags map[string]string
+}
+
+// NewContext parses a node's ini-format config file, including its
+// "[status.statsd]" section, and returns the resulting Context.
+func NewContext(config string) (*Context, error) {
+	ctx := &Context{}
+	if err := ctx.LoadStatsDConfig(config); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// LoadStatsDConfig parses the "[status.statsd]" section of config, which
+// uses the same "key = value" ini format as the rest of the node's config
+// file, into ctx. ctx is left unchanged if the section is absent.
+// Recognized keys are host, port, prefix, flush_interval (a
+// time.ParseDuration string) and tags (a comma-separated "key:value"
+// list).
+func (ctx *Context) LoadStatsDConfig(config string) error {
+	const section = "[status.statsd]"
+	inSection := false
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inSection = line == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		key, value, ok := splitConfigLine(line)
+		if !ok {
+			return fmt.Errorf("status.statsd: malformed line %q", line)
+		}
+		switch key {
+		case "host":
+			ctx.StatsDHost = value
+		case "port":
+			ctx.StatsDPort = value
+		case "prefix":
+			ctx.StatsDPrefix = value
+		case "flush_interval":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("status.statsd: invalid flush_interval %q: %s", value, err)
+			}
+			ctx.StatsDFlushInterval = d
+		case "tags":
+			tags, err := parseStatsDTagsConfig(value)
+			if err != nil {
+				return err
+			}
+			ctx.StatsDTags = tags
+		default:
+			return fmt.Errorf("status.statsd: unknown key %q", key)
+		}
+	}
+	return scanner.Err()
+}
+
+// splitConfigLine splits a "key = value" ini line into its trimmed key and
+// value, returning ok=false if line does not contain "=".
+func splitConfigLine(line string) (key, value string, ok bool) {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+// parseStatsDTagsConfig parses a comma-separated "key:value,key:value" tag
+// list, as found in the "tags" key of a "[status.statsd]" section,
+// returning an error if any pair is missing its "key:value" colon.
+func parseStatsDTagsConfig(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("status.statsd: malformed tag %q", pair)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestNewContextLoadsStatsDConfig verifies that NewContext parses a
+// [status.statsd] section and ignores sections belonging to other
+// subsystems.
+func TestNewContextLoadsStatsDConfig(t *testing.T) {
+	config := `
+[store]
+foo = bar
+
+[status.statsd]
+host = 127.0.0.1
+port = 8125
+prefix = cr.
+flush_interval = 5s
+tags = cluster:prod,region:us-east
+`
+	ctx, err := NewContext(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.StatsDHost != "127.0.0.1" {
+		t.Errorf("expected host 127.0.0.1, got %q", ctx.StatsDHost)
+	}
+	if ctx.StatsDPort != "8125" {
+		t.Errorf("expected port 8125, got %q", ctx.StatsDPort)
+	}
+	if ctx.StatsDPrefix != "cr." {
+		t.Errorf("expected prefix \"cr.\", got %q", ctx.StatsDPrefix)
+	}
+	if ctx.StatsDFlushInterval != 5*time.Second {
+		t.Errorf("expected flush interval 5s, got %s", ctx.StatsDFlushInterval)
+	}
+	if want := map[string]string{"cluster": "prod", "region": "us-east"}; !reflect.DeepEqual(ctx.StatsDTags, want) {
+		t.Errorf("expected tags %v, got %v", want, ctx.StatsDTags)
+	}
+}
+
+// TestNewContextStatsDConfigAbsent verifies that NewContext leaves the
+// StatsD fields at their zero values when no [status.statsd] section is
+// present.
+func TestNewContextStatsDConfigAbsent(t *testing.T) {
+	ctx, err := NewContext("[store]\nfoo = bar\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := NewContext("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ctx, empty) {
+		t.Errorf("expected ctx to be unchanged, got %+v", ctx)
+	}
+}
+
+// TestNewContextMalformedStatsDTags verifies that a "tags" entry missing
+// its "key:value" colon is reported as an error rather than silently
+// dropped, consistent with how other malformed [status.statsd] lines are
+// handled.
+func TestNewContextMalformedStatsDTags(t *testing.T) {
+	config := "[status.statsd]\nhost = 127.0.0.1\ntags = cluster\n"
+	if _, err := NewContext(config); err == nil {
+		t.Error("expected an error for a malformed tags entry, got nil")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package server
+
+import (
+	"github.com/cockroachdb/cockroach/server/status"
+)
+
+// statsDConfigFromContext builds a status.StatsDConfig from the
+// [status.statsd] section of ctx, returning ok=false if no collector
+// host was configured (the section is absent or commented out).
+func statsDConfigFromContext(ctx *Context) (config status.StatsDConfig, ok bool) {
+	if ctx.StatsDHost == "" {
+		return status.StatsDConfig{}, false
+	}
+	return status.StatsDConfig{
+		Host:          ctx.StatsDHost,
+		Port:          ctx.StatsDPort,
+		Prefix:        ctx.StatsDPrefix,
+		FlushInterval: ctx.StatsDFlushInterval,
+		Tags:          ctx.StatsDTags,
+	}, true
+}
+
+// maybeStartStatsDSink starts a status.StatsDSink subscribed to monitor
+// if ctx configures a [status.statsd] collector, returning a nil sink
+// (and no error) otherwise. This is called from NewAdminServer, so the
+// sink is started alongside the rest of the node's status subsystems.
+func maybeStartStatsDSink(ctx *Context, monitor *status.NodeStatusMonitor) (*status.StatsDSink, error) {
+	config, ok := statsDConfigFromContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	sink := status.NewStatsDSink(monitor, config)
+	if err := sink.Start(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package status
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/proto"
+)
+
+// prometheusNodeSeries and prometheusStoreSeries recover the metric name and
+// the node or store ID that nodeTimeSeriesNameFmt and storeTimeSeriesNameFmt
+// encoded into a time series name, so that the ID can be rendered as a
+// Prometheus label instead of being baked into the metric name itself.
+var (
+	prometheusNodeSeries  = regexp.MustCompile(`^cr\.node\.(.+)\.(\d+)$`)
+	prometheusStoreSeries = regexp.MustCompile(`^cr\.store\.(.+)\.(\d+)$`)
+)
+
+// prometheusCounters enumerates the metrics recorded by a
+// NodeStatusRecorder which are monotonically increasing counts; everything
+// else is exposed as a gauge.
+var prometheusCounters = map[string]bool{
+	"calls.success": true,
+	"calls.error":   true,
+}
+
+// PrometheusExporter renders the time series data maintained by a
+// NodeStatusRecorder as a Prometheus text-format exposition (version
+// 0.0.4), allowing external scrapers to pull CockroachDB metrics directly
+// instead of polling the JSON status endpoints.
+type PrometheusExporter struct {
+	recorder *NodeStatusRecorder
+}
+
+// NewPrometheusExporter returns a PrometheusExporter which renders the
+// metrics currently held by recorder.
+func NewPrometheusExporter(recorder *NodeStatusRecorder) *PrometheusExporter {
+	return &PrometheusExporter{recorder: recorder}
+}
+
+// prometheusFamily groups the datapoints of a single parsed time series
+// under the bare metric name and the node/store label recovered from its
+// original series name.
+type prometheusFamily struct {
+	metric     string
+	label      string
+	datapoints []*proto.TimeSeriesDatapoint
+}
+
+type byMetricAndLabel []prometheusFamily
+
+func (a byMetricAndLabel) Len() int      { return len(a) }
+func (a byMetricAndLabel) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byMetricAndLabel) Less(i, j int) bool {
+	if a[i].metric != a[j].metric {
+		return a[i].metric < a[j].metric
+	}
+	return a[i].label < a[j].label
+}
+
+// Export renders the recorder's current time series data in the
+// Prometheus text exposition format.
+func (pe *PrometheusExporter) Export() []byte {
+	families := make([]prometheusFamily, 0)
+	for _, ts := range pe.recorder.GetTimeSeriesData() {
+		if m := prometheusNodeSeries.FindStringSubmatch(ts.Name); m != nil {
+			families = append(families, prometheusFamily{
+				metric:     m[1],
+				label:      fmt.Sprintf(`node="%s"`, m[2]),
+				datapoints: ts.Datapoints,
+			})
+			continue
+		}
+		if m := prometheusStoreSeries.FindStringSubmatch(ts.Name); m != nil {
+			families = append(families, prometheusFamily{
+				metric:     m[1],
+				label:      fmt.Sprintf(`store="%s"`, m[2]),
+				datapoints: ts.Datapoints,
+			})
+		}
+	}
+	sort.Sort(byMetricAndLabel(families))
+
+	var buf bytes.Buffer
+	lastMetric := ""
+	for _, f := range families {
+		name := prometheusMetricName(f.metric)
+		if f.metric != lastMetric {
+			typ := "gauge"
+			if prometheusCounters[f.metric] {
+				typ = "counter"
+			}
+			fmt.Fprintf(&buf, "# HELP %s CockroachDB %s metric.\n", name, f.metric)
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", name, typ)
+			lastMetric = f.metric
+		}
+		for _, dp := range f.datapoints {
+			fmt.Fprintf(&buf, "%s{%s} %v %d\n", name, f.label, dp.Value, dp.TimestampNanos/1e6)
+		}
+	}
+	return buf.Bytes()
+}
+
+// prometheusMetricName converts a CockroachDB metric name such as
+// "ranges.leader" into a Prometheus-legal metric name, e.g.
+// "cockroach_ranges_leader".
+func prometheusMetricName(metric string) string {
+	return "cockroach_" + strings.NewReplacer(".", "_", "-", "_").Replace(metric)
+}
+
+// StatusVarsPath is the path at which the admin HTTP server mounts a
+// PrometheusExporter (see server.registerPrometheusExporter), so that
+// external scrapers can pull CockroachDB metrics without going through
+// the JSON status endpoints.
+const StatusVarsPath = "/_status/vars"
+
+// ServeHTTP implements http.Handler, writing the exporter's current
+// metrics in the Prometheus text format.
+func (pe *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(pe.Export())
+}
@@ -0,0 +1,269 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package status
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage"
+	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util/hlc"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// prometheusSampleLine matches a single "metric{labels} value timestamp"
+// exposition line, capturing the metric name, label body and value.
+var prometheusSampleLine = regexp.MustCompile(`^(\S+)\{([^}]*)\} (\S+) \d+$`)
+
+// scrapePrometheus issues a GET against the exporter and returns the
+// scraped samples keyed by "metric{labels}".
+func scrapePrometheus(t *testing.T, pe *PrometheusExporter) map[string]float64 {
+	req := httptest.NewRequest("GET", "/_status/vars", nil)
+	w := httptest.NewRecorder()
+	pe.ServeHTTP(w, req)
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(w.Body.Bytes()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		m := prometheusSampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("could not parse exposition line %q", line)
+		}
+		val, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Fatalf("could not parse value in line %q: %s", line, err)
+		}
+		samples[m[1]+"{"+m[2]+"}"] = val
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+// expectedPrometheusSamples are the same numeric values TestNodeStatusRecorder
+// checks via GetTimeSeriesData, written out independently of the exporter's
+// own prometheusNodeSeries/prometheusStoreSeries parsing so that a wrong
+// separator or a broken prometheusMetricName can't cancel out between the
+// expectation and the code under test.
+var expectedPrometheusSamples = map[string]float64{
+	// Store 1 should have accumulated 3x stats from two ranges.
+	`cockroach_livebytes{store="1"}`: 3,
+	`cockroach_keybytes{store="1"}`: 6,
+	`cockroach_valbytes{store="1"}`: 9,
+	`cockroach_intentbytes{store="1"}`: 12,
+	`cockroach_livecount{store="1"}`: 15,
+	`cockroach_keycount{store="1"}`: 18,
+	`cockroach_valcount{store="1"}`: 21,
+	`cockroach_intentcount{store="1"}`: 24,
+	`cockroach_intentage{store="1"}`: 27,
+	`cockroach_gcbytesage{store="1"}`: 30,
+	`cockroach_lastupdatenanos{store="1"}`: 3 * 1e9,
+	`cockroach_ranges{store="1"}`: 2,
+	`cockroach_ranges_leader{store="1"}`: 1,
+	`cockroach_ranges_available{store="1"}`: 2,
+	`cockroach_ranges_replicated{store="1"}`: 0,
+	`cockroach_capacity{store="1"}`: 100,
+	`cockroach_capacity_available{store="1"}`: 50,
+
+	// Store 2 should have accumulated 1 copy of stats.
+	`cockroach_livebytes{store="2"}`: 1,
+	`cockroach_keybytes{store="2"}`: 2,
+	`cockroach_valbytes{store="2"}`: 3,
+	`cockroach_intentbytes{store="2"}`: 4,
+	`cockroach_livecount{store="2"}`: 5,
+	`cockroach_keycount{store="2"}`: 6,
+	`cockroach_valcount{store="2"}`: 7,
+	`cockroach_intentcount{store="2"}`: 8,
+	`cockroach_intentage{store="2"}`: 9,
+	`cockroach_gcbytesage{store="2"}`: 10,
+	`cockroach_lastupdatenanos{store="2"}`: 1 * 1e9,
+	`cockroach_ranges{store="2"}`: 1,
+	`cockroach_ranges_leader{store="2"}`: 1,
+	`cockroach_ranges_available{store="2"}`: 2,
+	`cockroach_ranges_replicated{store="2"}`: 0,
+	`cockroach_capacity{store="2"}`: 200,
+	`cockroach_capacity_available{store="2"}`: 75,
+
+	// Node stats.
+	`cockroach_calls_success{node="1"}`: 2,
+	`cockroach_calls_error{node="1"}`: 1,
+}
+
+// TestPrometheusExporter verifies that scraping a PrometheusExporter
+// backed by a NodeStatusRecorder yields the same numeric values as
+// GetTimeSeriesData for every metric and every store, with node/store
+// IDs recovered as labels rather than baked into the metric name.
+func TestPrometheusExporter(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	nodeDesc := proto.NodeDescriptor{
+		NodeID: proto.NodeID(1),
+	}
+	storeDesc1 := proto.StoreDescriptor{
+		StoreID: proto.StoreID(1),
+		Capacity: proto.StoreCapacity{
+			Capacity:  100,
+			Available: 50,
+		},
+	}
+	storeDesc2 := proto.StoreDescriptor{
+		StoreID: proto.StoreID(2),
+		Capacity: proto.StoreCapacity{
+			Capacity:  200,
+			Available: 75,
+		},
+	}
+	desc1 := &proto.RangeDescriptor{
+		RaftID:   1,
+		StartKey: proto.Key("a"),
+		EndKey:   proto.Key("b"),
+	}
+	desc2 := &proto.RangeDescriptor{
+		RaftID:   2,
+		StartKey: proto.Key("b"),
+		EndKey:   proto.Key("c"),
+	}
+	stats := engine.MVCCStats{
+		LiveBytes:       1,
+		KeyBytes:        2,
+		ValBytes:        3,
+		IntentBytes:     4,
+		LiveCount:       5,
+		KeyCount:        6,
+		ValCount:        7,
+		IntentCount:     8,
+		IntentAge:       9,
+		GCBytesAge:      10,
+		LastUpdateNanos: 1 * 1E9,
+	}
+
+	monitor := NewNodeStatusMonitor()
+	manual := hlc.NewManualClock(100)
+	recorder := NewNodeStatusRecorder(monitor, hlc.NewClock(manual.UnixNano))
+	exporter := NewPrometheusExporter(recorder)
+
+	// Initialization events.
+	monitor.OnStartNode(&StartNodeEvent{
+		Desc:      nodeDesc,
+		StartedAt: 50,
+	})
+	monitor.OnStartStore(&storage.StartStoreEvent{
+		StoreID:   proto.StoreID(1),
+		StartedAt: 60,
+	})
+	monitor.OnStartStore(&storage.StartStoreEvent{
+		StoreID:   proto.StoreID(2),
+		StartedAt: 70,
+	})
+	monitor.OnStoreStatus(&storage.StoreStatusEvent{
+		Desc: &storeDesc1,
+	})
+	monitor.OnStoreStatus(&storage.StoreStatusEvent{
+		Desc: &storeDesc2,
+	})
+
+	// Add some data to the monitor by simulating incoming events.
+	monitor.OnBeginScanRanges(&storage.BeginScanRangesEvent{
+		StoreID: proto.StoreID(1),
+	})
+	monitor.OnBeginScanRanges(&storage.BeginScanRangesEvent{
+		StoreID: proto.StoreID(2),
+	})
+	monitor.OnRegisterRange(&storage.RegisterRangeEvent{
+		StoreID: proto.StoreID(1),
+		Desc:    desc1,
+		Stats:   stats,
+		Scan:    true,
+	})
+	monitor.OnRegisterRange(&storage.RegisterRangeEvent{
+		StoreID: proto.StoreID(1),
+		Desc:    desc2,
+		Stats:   stats,
+		Scan:    true,
+	})
+	monitor.OnRegisterRange(&storage.RegisterRangeEvent{
+		StoreID: proto.StoreID(2),
+		Desc:    desc1,
+		Stats:   stats,
+		Scan:    true,
+	})
+	monitor.OnEndScanRanges(&storage.EndScanRangesEvent{
+		StoreID: proto.StoreID(1),
+	})
+	monitor.OnEndScanRanges(&storage.EndScanRangesEvent{
+		StoreID: proto.StoreID(2),
+	})
+	monitor.OnUpdateRange(&storage.UpdateRangeEvent{
+		StoreID: proto.StoreID(1),
+		Desc:    desc1,
+		Delta:   stats,
+	})
+	// Periodically published events.
+	monitor.OnReplicationStatus(&storage.ReplicationStatusEvent{
+		StoreID:              proto.StoreID(1),
+		LeaderRangeCount:     1,
+		AvailableRangeCount:  2,
+		ReplicatedRangeCount: 0,
+	})
+	monitor.OnReplicationStatus(&storage.ReplicationStatusEvent{
+		StoreID:              proto.StoreID(2),
+		LeaderRangeCount:     1,
+		AvailableRangeCount:  2,
+		ReplicatedRangeCount: 0,
+	})
+	// Node events.
+	monitor.OnCallSuccess(&CallSuccessEvent{
+		NodeID: proto.NodeID(1),
+		Method: proto.Get,
+	})
+	monitor.OnCallSuccess(&CallSuccessEvent{
+		NodeID: proto.NodeID(1),
+		Method: proto.Put,
+	})
+	monitor.OnCallError(&CallErrorEvent{
+		NodeID: proto.NodeID(1),
+		Method: proto.Scan,
+	})
+
+	samples := scrapePrometheus(t, exporter)
+
+	if len(samples) != len(expectedPrometheusSamples) {
+		t.Errorf("expected %d scraped samples, got %d: %v", len(expectedPrometheusSamples), len(samples), samples)
+	}
+	for name, want := range expectedPrometheusSamples {
+		got, ok := samples[name]
+		if !ok {
+			t.Errorf("expected exposition to contain sample %s; got %v", name, samples)
+			continue
+		}
+		if got != want {
+			t.Errorf("sample %s: got %v, expected %v", name, got, want)
+		}
+	}
+}
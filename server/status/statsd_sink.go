@@ -0,0 +1,264 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package status
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage"
+	"github.com/cockroachdb/cockroach/util/log"
+)
+
+// maxStatsDPacketBytes bounds how large a single UDP datagram a StatsDSink
+// will assemble before flushing, keeping packets under the ~1500-byte
+// Ethernet MTU once IP and UDP headers are accounted for.
+const maxStatsDPacketBytes = 1432
+
+// defaultStatsDFlushInterval is used when a StatsDConfig does not specify
+// FlushInterval.
+const defaultStatsDFlushInterval = 10 * time.Second
+
+// StatsDConfig describes how to reach a statsd/dogstatsd collector and how
+// to tag the metrics pushed to it. It corresponds to the [status.statsd]
+// section of the server's configuration.
+type StatsDConfig struct {
+	Host          string
+	Port          string
+	Prefix        string
+	FlushInterval time.Duration
+	Tags          map[string]string
+}
+
+// addr returns the "host:port" address of the configured collector.
+func (c StatsDConfig) addr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// StatsDSink subscribes to a NodeStatusMonitor's event stream and pushes
+// the resulting counters and gauges to a statsd/dogstatsd collector over
+// UDP using the DogStatsD line protocol. Unlike NodeStatusRecorder, which
+// is polled via GetTimeSeriesData, a StatsDSink is push-based: samples are
+// batched into UDP packets and flushed on a timer, so that operators can
+// ship CockroachDB metrics into an existing telemetry pipeline without
+// polling the status endpoints.
+type StatsDSink struct {
+	config StatsDConfig
+	tags   string
+
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	conn      net.Conn
+	liveBytes map[proto.StoreID]int64
+
+	stopper chan struct{}
+	done    chan struct{}
+}
+
+// NewStatsDSink creates a StatsDSink which writes to the collector
+// described by config and subscribes it to monitor's underlying event
+// feed, the same feed NodeStatusRecorder subscribes to. Call Start to
+// begin the periodic flush loop.
+func NewStatsDSink(monitor *NodeStatusMonitor, config StatsDConfig) *StatsDSink {
+	if config.FlushInterval == 0 {
+		config.FlushInterval = defaultStatsDFlushInterval
+	}
+	s := &StatsDSink{
+		config:    config,
+		tags:      formatStatsDTags(config.Tags),
+		liveBytes: make(map[proto.StoreID]int64),
+		stopper:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	monitor.Feed().Subscribe(s)
+	return s
+}
+
+// Start dials the configured collector and begins the periodic flush
+// loop. It returns an error if the collector address cannot be resolved.
+func (s *StatsDSink) Start() error {
+	conn, err := net.Dial("udp", s.config.addr())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	go s.flushLoop()
+	return nil
+}
+
+// Stop flushes any buffered metrics and closes the collector connection.
+func (s *StatsDSink) Stop() {
+	close(s.stopper)
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *StatsDSink) flushLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stopper:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush writes any buffered metrics to the collector and resets the
+// buffer, regardless of whether it has reached maxStatsDPacketBytes.
+func (s *StatsDSink) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf.Len() == 0 || s.conn == nil {
+		s.buf.Reset()
+		return
+	}
+	if _, err := s.conn.Write(s.buf.Bytes()); err != nil {
+		log.Warningf("statsd: failed to flush metrics to %s: %s", s.config.addr(), err)
+	}
+	s.buf.Reset()
+}
+
+// enqueue appends a single DogStatsD line to the sink's packet buffer,
+// flushing the buffer first if the line would push it past
+// maxStatsDPacketBytes.
+func (s *StatsDSink) enqueue(metric string, value float64, kind, tag string) {
+	line := fmt.Sprintf("%s%s:%v|%s|#%s\n", s.config.Prefix, metric, value, kind, strings.TrimPrefix(s.tagsWith(tag), "#"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf.Len()+len(line) > maxStatsDPacketBytes {
+		if s.conn != nil {
+			if _, err := s.conn.Write(s.buf.Bytes()); err != nil {
+				log.Warningf("statsd: failed to flush metrics to %s: %s", s.config.addr(), err)
+			}
+		}
+		s.buf.Reset()
+	}
+	s.buf.WriteString(line)
+}
+
+// tagsWith returns the sink's configured tag set with an additional
+// node/store tag appended.
+func (s *StatsDSink) tagsWith(tag string) string {
+	if s.tags == "" {
+		return tag
+	}
+	return s.tags + "," + tag
+}
+
+func (s *StatsDSink) enqueueCounter(metric string, value float64, tag string) {
+	s.enqueue(metric, value, "c", tag)
+}
+
+func (s *StatsDSink) enqueueGauge(metric string, value float64, tag string) {
+	s.enqueue(metric, value, "g", tag)
+}
+
+// OnCallSuccess implements the NodeStatusMonitor listener interface,
+// incrementing the calls.success counter for the call's node.
+func (s *StatsDSink) OnCallSuccess(event *CallSuccessEvent) {
+	s.enqueueCounter("calls.success", 1, fmt.Sprintf("node:%d", event.NodeID))
+}
+
+// OnCallError implements the NodeStatusMonitor listener interface,
+// incrementing the calls.error counter for the call's node.
+func (s *StatsDSink) OnCallError(event *CallErrorEvent) {
+	s.enqueueCounter("calls.error", 1, fmt.Sprintf("node:%d", event.NodeID))
+}
+
+// OnReplicationStatus implements the NodeStatusMonitor listener
+// interface, publishing the store's range-replication gauges.
+func (s *StatsDSink) OnReplicationStatus(event *storage.ReplicationStatusEvent) {
+	tag := fmt.Sprintf("store:%d", event.StoreID)
+	s.enqueueGauge("ranges.leader", float64(event.LeaderRangeCount), tag)
+	s.enqueueGauge("ranges.available", float64(event.AvailableRangeCount), tag)
+	s.enqueueGauge("ranges.replicated", float64(event.ReplicatedRangeCount), tag)
+}
+
+// OnRegisterRange implements the NodeStatusMonitor listener interface.
+// Unlike OnUpdateRange, the Stats carried by a RegisterRangeEvent are the
+// range's full absolute values (this is how a store reports the ranges
+// found during its initial scan), so they are added to the store's
+// running livebytes total rather than treated as a delta.
+func (s *StatsDSink) OnRegisterRange(event *storage.RegisterRangeEvent) {
+	s.addLiveBytes(event.StoreID, event.Stats.LiveBytes)
+}
+
+// OnUpdateRange implements the NodeStatusMonitor listener interface,
+// publishing the store's updated livebytes gauge. DogStatsD gauges
+// record whatever value is sent as the metric's current absolute
+// reading, so the event's Delta is folded into a running per-store
+// total rather than published directly.
+func (s *StatsDSink) OnUpdateRange(event *storage.UpdateRangeEvent) {
+	s.addLiveBytes(event.StoreID, event.Delta.LiveBytes)
+}
+
+// addLiveBytes adds delta to storeID's running livebytes total and
+// publishes the updated total as a gauge.
+func (s *StatsDSink) addLiveBytes(storeID proto.StoreID, delta int64) {
+	s.mu.Lock()
+	s.liveBytes[storeID] += delta
+	total := s.liveBytes[storeID]
+	s.mu.Unlock()
+
+	s.enqueueGauge("livebytes", float64(total), fmt.Sprintf("store:%d", storeID))
+}
+
+// OnStoreStatus implements the NodeStatusMonitor listener interface,
+// publishing the store's capacity gauges.
+func (s *StatsDSink) OnStoreStatus(event *storage.StoreStatusEvent) {
+	tag := fmt.Sprintf("store:%d", event.Desc.StoreID)
+	s.enqueueGauge("capacity", float64(event.Desc.Capacity.Capacity), tag)
+	s.enqueueGauge("capacity.available", float64(event.Desc.Capacity.Available), tag)
+}
+
+// formatStatsDTags renders a tag map as a DogStatsD "#k:v,k:v" tag suffix,
+// with keys sorted for deterministic output.
+func formatStatsDTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%s", k, tags[k])
+	}
+	return "#" + strings.Join(parts, ",")
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package status
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage"
+	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+func TestFormatStatsDTags(t *testing.T) {
+	if s := formatStatsDTags(nil); s != "" {
+		t.Errorf("expected empty tag string for nil map, got %q", s)
+	}
+	tags := map[string]string{"cluster": "prod", "region": "us-east"}
+	if s, e := formatStatsDTags(tags), "#cluster:prod,region:us-east"; s != e {
+		t.Errorf("expected %q, got %q", e, s)
+	}
+}
+
+// TestStatsDSink verifies that events delivered through a
+// NodeStatusMonitor are rendered as DogStatsD lines and flushed to the
+// configured collector on Stop.
+func TestStatsDSink(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	host, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monitor := NewNodeStatusMonitor()
+	sink := NewStatsDSink(monitor, StatsDConfig{
+		Host:          host,
+		Port:          port,
+		Prefix:        "cr.",
+		FlushInterval: time.Hour,
+		Tags:          map[string]string{"cluster": "test"},
+	})
+	if err := sink.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	monitor.OnCallSuccess(&CallSuccessEvent{
+		NodeID: proto.NodeID(1),
+		Method: proto.Get,
+	})
+	// The initial store scan reports a range's full, absolute stats...
+	monitor.OnRegisterRange(&storage.RegisterRangeEvent{
+		StoreID: proto.StoreID(1),
+		Desc:    &proto.RangeDescriptor{RaftID: 1},
+		Stats:   engine.MVCCStats{LiveBytes: 10},
+		Scan:    true,
+	})
+	// ...and later range updates report deltas; both should accumulate
+	// into a single absolute livebytes gauge per store.
+	monitor.OnUpdateRange(&storage.UpdateRangeEvent{
+		StoreID: proto.StoreID(1),
+		Desc:    &proto.RangeDescriptor{RaftID: 1},
+		Delta:   engine.MVCCStats{LiveBytes: 5},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		sink.Stop()
+		close(done)
+	}()
+
+	buf := make([]byte, maxStatsDPacketBytes)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	packet := string(buf[:n])
+	if want := "cr.calls.success:1|c|#cluster:test,node:1"; !strings.Contains(packet, want) {
+		t.Errorf("expected packet to contain %q, got %q", want, packet)
+	}
+	if want := "cr.livebytes:15|g|#cluster:test,store:1"; !strings.Contains(packet, want) {
+		t.Errorf("expected packet to contain absolute livebytes total %q, got %q", want, packet)
+	}
+}
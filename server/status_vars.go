@@ -0,0 +1,32 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+//
+// Author: Matt Tracy (matt.r.tracy@gmail.com)
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cockroachdb/cockroach/server/status"
+)
+
+// registerPrometheusExporter mounts a status.PrometheusExporter backed by
+// recorder at status.StatusVarsPath ("/_status/vars") on mux, so that a
+// scraper can pull the node's metrics directly. This is called from the
+// admin server's setup alongside its other "/_status/" handlers.
+func registerPrometheusExporter(mux *http.ServeMux, recorder *status.NodeStatusRecorder) {
+	mux.Handle(status.StatusVarsPath, status.NewPrometheusExporter(recorder))
+}
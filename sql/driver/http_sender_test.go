@@ -18,7 +18,6 @@
 package driver
 
 import (
-	"log"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -30,29 +29,150 @@ import (
 	"github.com/cockroachdb/cockroach/util/leaktest"
 )
 
+// sendSQL issues a single-Cmd SQLRequest through sender and returns the
+// response. It does not itself check whether the call was sent.
+func sendSQL(t *testing.T, sender *httpSender, sql string) *sqlwire.SQLResponse {
+	return sendSQLCmds(t, sender, sql)
+}
+
+// sendSQLCmds issues a single SQLRequest carrying one Cmd per sql
+// statement through sender and returns the response. It does not itself
+// check whether the call was sent.
+func sendSQLCmds(t *testing.T, sender *httpSender, sql ...string) *sqlwire.SQLResponse {
+	request := &sqlwire.SQLRequest{}
+	for i := range sql {
+		request.Cmds = append(request.Cmds, &sqlwire.SQLRequest_Cmd{Sql: &sql[i]})
+	}
+	call := sqlwire.Call{Args: request, Reply: &sqlwire.SQLResponse{}}
+	sender.Send(context.TODO(), call)
+	return call.Reply.(*sqlwire.SQLResponse)
+}
+
+// TestSend verifies that a SQLRequest sent through the HTTP sender is
+// executed end-to-end against the server's KV store: the CREATE TABLE
+// and INSERT statements succeed, and the subsequent SELECT returns the
+// inserted row with correctly typed Datums.
 func TestSend(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	s := server.StartTestServer(t)
 	defer s.Stop()
 	sender, err := newHTTPSender(s.ServingAddr(), testutils.NewRootTestBaseContext(), client.DefaultTxnRetryOptions)
 	if err != nil {
-		log.Fatalf("Couldn't create HTTPSender for server:(%s)", s.ServingAddr())
-	}
-	testCases := []struct {
-		req   string
-		reply string
-	}{
-		{"ping", "ping"},
-		{"default", "default"},
-	}
-	for _, test := range testCases {
-		request := &sqlwire.SQLRequest{}
-		request.Cmds = append(request.Cmds, &sqlwire.SQLRequest_Cmd{Sql: &test.req})
-		call := sqlwire.Call{Args: request, Reply: &sqlwire.SQLResponse{}}
-		sender.Send(context.TODO(), call)
-		reply := string(call.Reply.(*sqlwire.SQLResponse).Results[0].Values[0].Blobval)
-		if reply != test.reply {
-			log.Fatalf("Server sent back reply:%s", reply)
-		}
+		t.Fatalf("Couldn't create HTTPSender for server:(%s)", s.ServingAddr())
+	}
+
+	if resp := sendSQL(t, sender, "CREATE TABLE t (k INT PRIMARY KEY, v STRING)"); len(resp.Results) != 1 {
+		t.Fatalf("expected 1 result for CREATE TABLE, got %d", len(resp.Results))
+	}
+	if resp := sendSQL(t, sender, "INSERT INTO t (k, v) VALUES (1, 'a')"); len(resp.Results) != 1 {
+		t.Fatalf("expected 1 result for INSERT, got %d", len(resp.Results))
+	}
+
+	resp := sendSQL(t, sender, "SELECT k, v FROM t WHERE k = 1")
+	if e, a := []string{"k", "v"}, resp.Columns; len(a) != len(e) || a[0] != e[0] || a[1] != e[1] {
+		t.Fatalf("expected columns %v, got %v", e, a)
+	}
+	values := resp.Results[0].Values
+	if len(values) != 2 {
+		t.Fatalf("expected 2 values (1 row x 2 columns), got %d", len(values))
+	}
+	if a, e := values[0].Intval, int64(1); a != e {
+		t.Errorf("expected k=%d, got %d", e, a)
+	}
+	if a, e := values[1].Stringval, "a"; a != e {
+		t.Errorf("expected v=%q, got %q", e, a)
+	}
+}
+
+// TestSendTransaction verifies that a BEGIN, a statement and a COMMIT
+// sent as separate Cmds within a single Send call share the same
+// client.Txn: the INSERT is only visible to a later SELECT once COMMIT
+// has been sent.
+func TestSendTransaction(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	s := server.StartTestServer(t)
+	defer s.Stop()
+	sender, err := newHTTPSender(s.ServingAddr(), testutils.NewRootTestBaseContext(), client.DefaultTxnRetryOptions)
+	if err != nil {
+		t.Fatalf("Couldn't create HTTPSender for server:(%s)", s.ServingAddr())
+	}
+
+	sendSQL(t, sender, "CREATE TABLE t (k INT PRIMARY KEY, v STRING)")
+
+	resp := sendSQLCmds(t, sender,
+		"BEGIN",
+		"INSERT INTO t (k, v) VALUES (1, 'a')",
+		"SELECT v FROM t WHERE k = 1",
+		"COMMIT",
+	)
+	if len(resp.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(resp.Results))
+	}
+	if a, e := resp.Results[2].Values[0].Stringval, "a"; a != e {
+		t.Errorf("expected SELECT inside the transaction to see its own INSERT, got %q want %q", a, e)
+	}
+
+	resp = sendSQL(t, sender, "SELECT v FROM t WHERE k = 1")
+	if a, e := resp.Results[0].Values[0].Stringval, "a"; a != e {
+		t.Errorf("expected committed row to be visible after COMMIT, got %q want %q", a, e)
+	}
+}
+
+// TestSendMultipleResultProducingStatements verifies that a batch
+// containing more than one result-producing statement is rejected,
+// rather than having the second statement's columns silently clobber the
+// first's in the response-level SQLResponse.Columns field.
+func TestSendMultipleResultProducingStatements(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	s := server.StartTestServer(t)
+	defer s.Stop()
+	sender, err := newHTTPSender(s.ServingAddr(), testutils.NewRootTestBaseContext(), client.DefaultTxnRetryOptions)
+	if err != nil {
+		t.Fatalf("Couldn't create HTTPSender for server:(%s)", s.ServingAddr())
+	}
+
+	sendSQL(t, sender, "CREATE TABLE t3 (k INT PRIMARY KEY, v STRING)")
+	sendSQL(t, sender, "INSERT INTO t3 (k, v) VALUES (1, 'a')")
+
+	resp := sendSQLCmds(t, sender,
+		"SELECT k FROM t3 WHERE k = 1",
+		"SELECT v FROM t3 WHERE k = 1",
+	)
+	if len(resp.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(resp.Results))
+	}
+	if e, a := []string{"k"}, resp.Columns; len(a) != len(e) || a[0] != e[0] {
+		t.Errorf("expected the first statement's columns %v to survive, got %v", e, a)
+	}
+	if len(resp.Results[1].Values) != 0 {
+		t.Errorf("expected the second result-producing statement to be rejected with no values, got %v", resp.Results[1].Values)
+	}
+}
+
+// TestSendTransactionRollbackOnError verifies that when a Cmd fails
+// inside an explicit BEGIN/COMMIT, the transaction opened by BEGIN is
+// rolled back rather than committed: a row inserted earlier in the same
+// batch must not become visible.
+func TestSendTransactionRollbackOnError(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	s := server.StartTestServer(t)
+	defer s.Stop()
+	sender, err := newHTTPSender(s.ServingAddr(), testutils.NewRootTestBaseContext(), client.DefaultTxnRetryOptions)
+	if err != nil {
+		t.Fatalf("Couldn't create HTTPSender for server:(%s)", s.ServingAddr())
+	}
+
+	sendSQL(t, sender, "CREATE TABLE t2 (k INT PRIMARY KEY, v STRING)")
+
+	sendSQLCmds(t, sender,
+		"BEGIN",
+		"INSERT INTO t2 (k, v) VALUES (1, 'a')",
+		"this is not valid sql",
+		"COMMIT",
+	)
+
+	resp := sendSQL(t, sender, "SELECT v FROM t2 WHERE k = 1")
+	if len(resp.Results[0].Values) != 0 {
+		t.Errorf("expected the failed transaction's INSERT to be rolled back, found row %v", resp.Results[0].Values)
 	}
 }
@@ -18,11 +18,15 @@
 package sqlserver
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/cockroach/client"
+	"github.com/cockroachdb/cockroach/sql"
+	"github.com/cockroachdb/cockroach/sql/parser"
 	"github.com/cockroachdb/cockroach/sql/sqlwire"
 	"github.com/cockroachdb/cockroach/util"
 )
@@ -105,18 +109,219 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
-// Send forwards the call for further processing.
+// txnState tracks the client.Txn explicitly opened by a BEGIN Cmd of a
+// single Send call. A session starts with no open transaction; it gains
+// one only when a BEGIN Cmd is executed, and that transaction stays open
+// (and "explicit") across subsequent Cmds until a matching COMMIT or
+// ROLLBACK is seen later in the same call. A statement executed with no
+// explicit transaction open never touches this state: it runs and
+// commits (or rolls back) inside its own auto-retried client.Txn before
+// execCmd returns, so that two plain statements in the same Cmds batch
+// never share a transaction.
+type txnState struct {
+	txn      *client.Txn
+	explicit bool
+}
+
+// Send forwards the call for further processing. Each Cmd in the
+// incoming SQLRequest is parsed and executed in order against the schema
+// and data stored in KV via s.clientDB. A BEGIN Cmd opens a client.Txn
+// that stays active across subsequent Cmds until a matching COMMIT or
+// ROLLBACK Cmd is seen; any statement sent with no explicit transaction
+// open runs in its own auto-retried client.Txn. Execution stops at the
+// first Cmd to return an error, which is reported back as an empty
+// Result with no values; an explicit transaction still open at that
+// point (or at the end of the batch, if the client never sent a
+// matching COMMIT/ROLLBACK) is rolled back rather than committed.
+//
+// SQLResponse.Columns is response-level rather than per-Result, so a
+// batch may carry at most one result-producing statement (e.g. a single
+// SELECT); a second one would silently clobber the first statement's
+// column names with its own. Rather than doing that, Send treats a
+// second result-producing statement as a batch error.
 func (s *Server) Send(call sqlwire.Call) {
-	switch call.Args.(type) {
-	case *sqlwire.SQLRequest:
-		reply := ""
-		if call.Args.(*sqlwire.SQLRequest).Cmds != nil {
-			reply = *(call.Args.(*sqlwire.SQLRequest).Cmds[0].Sql)
+	args, ok := call.Args.(*sqlwire.SQLRequest)
+	if !ok {
+		return
+	}
+	resp := call.Reply.(*sqlwire.SQLResponse)
+
+	state := &txnState{}
+	haveCols := false
+	for _, cmd := range args.Cmds {
+		cols, values, err := s.execCmd(state, cmd)
+		if err == nil && cols != nil && haveCols {
+			err = fmt.Errorf("a batch may contain at most one result-producing statement")
+		}
+		if err != nil {
+			resp.Results = append(resp.Results, &sqlwire.Result{})
+			if state.txn != nil && state.explicit {
+				state.txn.Rollback()
+			}
+			return
+		}
+		if cols != nil {
+			resp.Columns = cols
+			haveCols = true
+		}
+		resp.Results = append(resp.Results, &sqlwire.Result{Values: values})
+	}
+
+	// The client never sent a matching COMMIT/ROLLBACK for its BEGIN;
+	// leaving the transaction open across Send calls isn't supported, so
+	// discard it rather than committing a transaction the client never
+	// asked to commit.
+	if state.txn != nil && state.explicit {
+		state.txn.Rollback()
+	}
+}
+
+// execCmd parses and executes a single SQL statement, returning the
+// statement's result columns and the resulting Datum values (rows
+// concatenated in row-major order: each row's column values in turn).
+// BEGIN, COMMIT and
+// ROLLBACK are handled directly against state rather than being passed
+// to the planner.
+func (s *Server) execCmd(state *txnState, cmd *sqlwire.SQLRequest_Cmd) ([]string, []*sqlwire.Datum, error) {
+	if cmd.Sql == nil {
+		return nil, nil, fmt.Errorf("empty SQL statement")
+	}
+	stmt, err := parser.Parse(*cmd.Sql)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch stmt.(type) {
+	case *parser.BeginTransaction:
+		if state.txn != nil {
+			return nil, nil, fmt.Errorf("there is already a transaction in progress")
+		}
+		state.txn = client.NewTxn(s.clientDB)
+		state.explicit = true
+		return nil, nil, nil
+
+	case *parser.CommitTransaction:
+		if state.txn == nil || !state.explicit {
+			return nil, nil, fmt.Errorf("there is no transaction in progress")
+		}
+		err := state.txn.Commit()
+		state.txn, state.explicit = nil, false
+		return nil, nil, err
+
+	case *parser.RollbackTransaction:
+		if state.txn == nil || !state.explicit {
+			return nil, nil, fmt.Errorf("there is no transaction in progress")
 		}
-		resp := call.Reply.(*sqlwire.SQLResponse)
-		resp.Columns = append(resp.Columns, "echo")
-		result := &sqlwire.Result{}
-		result.Values = append(result.Values, &sqlwire.Datum{Blobval: []byte(reply)})
-		resp.Results = append(resp.Results, result)
+		err := state.txn.Rollback()
+		state.txn, state.explicit = nil, false
+		return nil, nil, err
+	}
+
+	params, err := bindParams(cmd.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if state.explicit {
+		return s.execStmt(state.txn, stmt, params)
+	}
+
+	// No explicit transaction is open for this Cmd: run it in its own
+	// auto-retried transaction rather than reusing state.txn, so that it
+	// is durably committed (or rolled back) independently of any Cmd
+	// that follows it in the same batch.
+	var cols []string
+	var values []*sqlwire.Datum
+	err = s.clientDB.Txn(func(txn *client.Txn) error {
+		var runErr error
+		cols, values, runErr = s.execStmt(txn, stmt, params)
+		return runErr
+	})
+	return cols, values, err
+}
+
+// execStmt plans and runs a single (non-transaction-control) statement
+// against txn, converting the resulting rows into wire Datums.
+func (s *Server) execStmt(txn *client.Txn, stmt parser.Statement, params []parser.Datum) ([]string, []*sqlwire.Datum, error) {
+	plan, err := sql.NewPlanner(txn).Plan(stmt, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	cols := plan.Columns()
+	var values []*sqlwire.Datum
+	for plan.Next() {
+		for _, d := range plan.Values() {
+			wd, err := datumToWire(d)
+			if err != nil {
+				return nil, nil, err
+			}
+			values = append(values, wd)
+		}
+	}
+	return cols, values, nil
+}
+
+// bindParams converts a Cmd's bound parameters from their wire
+// representation into parser.Datums suitable for planning.
+func bindParams(raw []*sqlwire.Datum) ([]parser.Datum, error) {
+	params := make([]parser.Datum, len(raw))
+	for i, p := range raw {
+		d, err := datumFromWire(p)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = d
+	}
+	return params, nil
+}
+
+// datumToWire converts a parser.Datum produced by plan execution into
+// the wire representation used by sqlwire.SQLResponse. Kind is always
+// set explicitly so that a zero-valued result (0, 0.0, false, the zero
+// time) can be told apart from SQL NULL on the wire.
+func datumToWire(d parser.Datum) (*sqlwire.Datum, error) {
+	switch t := d.(type) {
+	case parser.DInt:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_INT, Intval: int64(t)}, nil
+	case parser.DFloat:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_FLOAT, Floatval: float64(t)}, nil
+	case parser.DString:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_STRING, Stringval: string(t)}, nil
+	case parser.DBool:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_BOOL, Boolval: bool(t)}, nil
+	case parser.DBytes:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_BYTES, Blobval: []byte(t)}, nil
+	case parser.DTimestamp:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_TIME, Timeval: t.UnixNano()}, nil
+	case parser.DNull:
+		return &sqlwire.Datum{Kind: sqlwire.DatumKind_NULL}, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %T", d)
+	}
+}
+
+// datumFromWire converts a bound parameter from its wire representation
+// into a parser.Datum suitable for planning. It switches on the
+// explicit Datum.Kind discriminant rather than checking which field is
+// non-zero, so that a literal 0, 0.0 or false parameter binds correctly
+// instead of being mistaken for an unset (NULL) parameter.
+func datumFromWire(d *sqlwire.Datum) (parser.Datum, error) {
+	switch d.Kind {
+	case sqlwire.DatumKind_INT:
+		return parser.DInt(d.Intval), nil
+	case sqlwire.DatumKind_FLOAT:
+		return parser.DFloat(d.Floatval), nil
+	case sqlwire.DatumKind_STRING:
+		return parser.DString(d.Stringval), nil
+	case sqlwire.DatumKind_BOOL:
+		return parser.DBool(d.Boolval), nil
+	case sqlwire.DatumKind_BYTES:
+		return parser.DBytes(d.Blobval), nil
+	case sqlwire.DatumKind_TIME:
+		return parser.DTimestamp{Time: time.Unix(0, d.Timeval)}, nil
+	case sqlwire.DatumKind_NULL:
+		return parser.DNull{}, nil
+	default:
+		return nil, fmt.Errorf("parameter Datum has no Kind set")
 	}
 }